@@ -38,8 +38,42 @@ type Lock struct {
 	UID       uint32    `json:"uid,omitempty"`
 	GID       uint32    `json:"gid,omitempty"`
 
+	// LeaseDuration is the amount of time the lock remains valid without
+	// being refreshed. It is only set for locks created by NewLockWithOptions
+	// with LockOptions.Lease; other locks, including those created by NewLock
+	// and by older versions of restic, leave it at zero, in which case Stale
+	// falls back to the legacy timestamp/process based check.
+	LeaseDuration time.Duration `json:"leaseDuration,omitempty"`
+	// Expiry is the point in time at which the lease granted by LeaseDuration
+	// runs out. checkForOtherLocks treats any lock whose Expiry has passed as
+	// stale, regardless of which host created it.
+	Expiry time.Time `json:"expiry,omitempty"`
+	// FencingToken is a number handed out by NewLockWithOptions when
+	// LockOptions.Lease is set (it is zero otherwise) that is larger than
+	// that of any lock visible in the repository when this lock was acquired. It is intended for long-running operations (backup,
+	// prune) to stamp onto the pack/index uploads they write and refuse to
+	// continue once a newer lock has advanced the token past the one they
+	// stamped — but no such stamping or write-side check exists yet
+	// anywhere in this tree; FencingToken is only populated and compared
+	// against itself within the locking code so far. Wiring it into the
+	// upload path is tracked as follow-up work, not done by this change.
+	// Note also that it is derived from a plain list of existing locks
+	// rather than an atomic counter, so two processes racing to acquire a
+	// lock at the same time can compute the same value; it narrows, but
+	// does not by itself close, the window in which two processes could
+	// believe they hold the lock. A backend that implements LockBackend
+	// with an atomic compare-and-create primitive is required for a hard
+	// guarantee.
+	FencingToken uint64 `json:"fencingToken,omitempty"`
+
 	repo   Unpacked[FileType]
 	lockID *ID
+
+	// backend and backendHandle are set when the lock was acquired through a
+	// LockBackend instead of the generic file-based protocol. See
+	// lock_backend.go.
+	backend       LockBackend
+	backendHandle LockHandle
 }
 
 // alreadyLockedError is returned when NewLock or NewExclusiveLock are unable to
@@ -86,6 +120,16 @@ func IsInvalidLock(err error) bool {
 
 var ErrRemovedLock = errors.New("lock file was removed in the meantime")
 
+// ErrFencingTokenSuperseded is returned by RefreshStaleLock when another
+// process has already acquired a lock with a higher fencing token, meaning
+// it is no longer safe to assume exclusivity over the repository.
+var ErrFencingTokenSuperseded = errors.New("a newer lock was already acquired for this repository")
+
+// DefaultLeaseDuration is the lease length used by NewLockWithOptions when
+// LockOptions.Lease is set and LockOptions.LeaseDuration is zero. NewLock
+// does not use a lease.
+const DefaultLeaseDuration = StaleLockTimeout
+
 var waitBeforeLockCheck = 200 * time.Millisecond
 
 // delay increases by factor 2 on each retry
@@ -103,12 +147,89 @@ func TestSetLockTimeout(t testing.TB, d time.Duration) {
 // that satisfies IsAlreadyLocked. If the new lock is exclude, then other
 // non-exclusive locks also result in an IsAlreadyLocked error.
 func NewLock(ctx context.Context, repo Unpacked[FileType], exclusive bool) (*Lock, error) {
+	return NewLockWithOptions(ctx, repo, LockOptions{Exclusive: exclusive})
+}
+
+// LockOptions controls how NewLockWithOptions acquires a lock.
+type LockOptions struct {
+	Exclusive bool
+	// Lease opts into lease-based staleness and fencing, using Expiry and
+	// FencingToken instead of the legacy timestamp/process based check that
+	// Stale otherwise falls back to. It defaults to false so that NewLock,
+	// which has callers throughout the codebase that are not yet prepared to
+	// call Refresh on the tighter lease schedule, keeps its existing
+	// behavior unchanged. It also gates whether a FencingToken is computed
+	// at all: doing so requires an extra, non-retried listing of the
+	// repository's locks, which legacy (non-lease) callers should not pay
+	// for, and the resulting token is otherwise never read.
+	Lease bool
+	// LeaseDuration is the amount of time the lock stays valid without being
+	// refreshed. Only used when Lease is true; if zero, DefaultLeaseDuration
+	// is used.
+	LeaseDuration time.Duration
+	// Backend, if set, is used instead of the list-sleep-list protocol to
+	// acquire, refresh and release the lock; see LockBackend. This is the
+	// normal way to wire up a native locking primitive: the code that
+	// constructs repo for a particular backend (e.g. the local backend)
+	// also owns the matching LockBackend implementation and passes it here
+	// explicitly. NewLockWithOptions additionally type-asserts repo itself
+	// against LockBackend as a fallback, for the case where a backend's
+	// repo type implements both interfaces directly.
+	Backend LockBackend
+}
+
+// NewLockWithOptions returns a new lock for the repository. When
+// opts.Lease is set, the lock carries an Expiry that must be extended
+// periodically via Refresh; checkForOtherLocks and Stale then judge
+// staleness purely from Expiry instead of the legacy timestamp/process
+// check, which lets a lease-based lock be reclaimed after the process that
+// created it has gone away, even if it was created on a different host or
+// its PID has since been reused there. This assumes participating hosts'
+// clocks are synchronized to within a bound that is small relative to
+// LeaseDuration (e.g. via NTP): unlike a true fencing service, Expiry is
+// still a wall-clock timestamp compared against the reader's own clock, so
+// uncorrected skew shifts the effective lease length by roughly the skew
+// between the two hosts. Choose LeaseDuration with enough margin above the
+// expected skew plus the refresh interval. The lock is also assigned a
+// FencingToken that is larger than that of any lock visible in the
+// repository at acquisition time; because it is derived from a plain list
+// rather than an atomic counter, two processes racing to acquire a lock at
+// the same moment can observe the same maximum and mint equal tokens, so it
+// does not by itself guarantee mutual exclusion between them. Real
+// protection against two processes simultaneously believing they hold the
+// lock requires a backend that implements LockBackend with an atomic
+// compare-and-create primitive.
+func NewLockWithOptions(ctx context.Context, repo Unpacked[FileType], opts LockOptions) (*Lock, error) {
+	var leaseDuration time.Duration
+	if opts.Lease {
+		leaseDuration = opts.LeaseDuration
+		if leaseDuration == 0 {
+			leaseDuration = DefaultLeaseDuration
+		}
+	}
+
+	// prefer a backend-native locking primitive when one was supplied
+	// explicitly, or the repo itself implements LockBackend, as it can
+	// acquire (or reject) an exclusive lock in a single round trip instead
+	// of the list-sleep-list dance below
+	backend := opts.Backend
+	if backend == nil {
+		if b, ok := repo.(LockBackend); ok {
+			backend = b
+		}
+	}
+
+	now := time.Now()
 	lock := &Lock{
-		Time:      time.Now(),
+		Time:      now,
 		PID:       os.Getpid(),
-		Exclusive: exclusive,
+		Exclusive: opts.Exclusive,
 		repo:      repo,
 	}
+	if opts.Lease {
+		lock.LeaseDuration = leaseDuration
+		lock.Expiry = now.Add(leaseDuration)
+	}
 
 	hn, err := os.Hostname()
 	if err == nil {
@@ -119,6 +240,23 @@ func NewLock(ctx context.Context, repo Unpacked[FileType], exclusive bool) (*Loc
 		return nil, err
 	}
 
+	if opts.Lease {
+		lock.FencingToken, err = nextFencingToken(ctx, repo, backend)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if backend != nil {
+		handle, err := backend.TryAcquire(ctx, lock)
+		if err != nil {
+			return nil, err
+		}
+		lock.backend = backend
+		lock.backendHandle = handle
+		return lock, nil
+	}
+
 	if err = lock.checkForOtherLocks(ctx); err != nil {
 		return nil, err
 	}
@@ -140,6 +278,57 @@ func NewLock(ctx context.Context, repo Unpacked[FileType], exclusive bool) (*Loc
 	return lock, nil
 }
 
+// maxFencingToken returns the largest FencingToken among locks. It is a pure
+// helper factored out of nextFencingToken so the token arithmetic can be
+// tested without a repository.
+//
+// Note that computing max(existing)+1 from a plain list is inherently
+// racy: two processes that list concurrently can both observe the same max
+// and mint the same token. Closing that race requires an atomically
+// allocated counter, which is only available through a LockBackend with a
+// compare-and-create primitive.
+func maxFencingToken(locks []*Lock) uint64 {
+	var highest uint64
+	for _, lock := range locks {
+		if lock != nil && lock.FencingToken > highest {
+			highest = lock.FencingToken
+		}
+	}
+	return highest
+}
+
+// nextFencingToken returns a fencing token guaranteed to be larger than that
+// of any lock currently visible in the repository at the time of listing;
+// see maxFencingToken for the race this does not close. If backend is
+// non-nil, it is used to list locks instead of the generic ForAllLocks
+// fallback; pass the same backend that NewLockWithOptions resolved, so a
+// repo that only implements LockBackend via an explicit LockOptions.Backend
+// still gets a consistent view.
+func nextFencingToken(ctx context.Context, repo Unpacked[FileType], backend LockBackend) (uint64, error) {
+	if backend != nil {
+		locks, err := backend.List(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return maxFencingToken(locks) + 1, nil
+	}
+
+	var locks []*Lock
+	err := ForAllLocks(ctx, repo, NewIDSet(), func(_ ID, lock *Lock, err error) error {
+		if err != nil {
+			// an unreadable lock is handled separately by checkForOtherLocks;
+			// it must not prevent handing out the next fencing token.
+			return nil
+		}
+		locks = append(locks, lock)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return maxFencingToken(locks) + 1, nil
+}
+
 func (l *Lock) fillUserInfo() error {
 	usr, err := user.Current()
 	if err != nil {
@@ -185,6 +374,13 @@ func (l *Lock) checkForOtherLocks(ctx context.Context) error {
 				return err
 			}
 
+			if isLeaseExpired(lock) {
+				// the lease has run out, so this lock no longer blocks new
+				// locks, regardless of which host created it
+				debug.Log("ignore lock %v: lease expired at %v", id, lock.Expiry)
+				return nil
+			}
+
 			if l.Exclusive {
 				return &alreadyLockedError{otherLock: lock}
 			}
@@ -239,25 +435,54 @@ func (l *Lock) createLock(ctx context.Context) (ID, error) {
 
 // Unlock removes the lock from the repository.
 func (l *Lock) Unlock(ctx context.Context) error {
-	if l == nil || l.lockID == nil {
+	if l == nil {
 		return nil
 	}
 
 	ctx, cancel := delayedCancelContext(ctx, UnlockCancelDelay)
 	defer cancel()
 
+	if l.backend != nil {
+		return l.backend.Release(ctx, l.backendHandle)
+	}
+
+	if l.lockID == nil {
+		return nil
+	}
+
 	return l.repo.RemoveUnpacked(ctx, LockFile, *l.lockID)
 }
 
 var StaleLockTimeout = 30 * time.Minute
 
-// Stale returns true if the lock is stale. A lock is stale if the timestamp is
-// older than 30 minutes or if it was created on the current machine and the
-// process isn't alive any more.
+// isLeaseExpired reports whether lock was created with a lease (via
+// NewLockWithOptions) that has since expired. Locks without a lease, e.g.
+// ones created by an older version of restic, always return false here and
+// fall back to the legacy checks in Stale.
+func isLeaseExpired(lock *Lock) bool {
+	if lock.LeaseDuration == 0 {
+		return false
+	}
+	return lock.Expiry.Before(time.Now())
+}
+
+// Stale returns true if the lock is stale. A lock created with a lease (via
+// NewLockWithOptions) is stale once its Expiry has passed. Otherwise, a lock
+// is stale if the timestamp is older than 30 minutes or if it was created on
+// the current machine and the process isn't alive any more.
 func (l *Lock) Stale() bool {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	debug.Log("testing if lock %v for process %d is stale", l.lockID, l.PID)
+	if isLeaseExpired(l) {
+		debug.Log("lock is stale, lease expired at %v\n", l.Expiry)
+		return true
+	}
+	if l.LeaseDuration > 0 {
+		// a lock with an unexpired lease is never considered stale, even
+		// across hosts or after PID reuse
+		return false
+	}
 	if time.Since(l.Time) > StaleLockTimeout {
 		debug.Log("lock is stale, timestamp is too old: %v\n", l.Time)
 		return true
@@ -305,12 +530,29 @@ func delayedCancelContext(parentCtx context.Context, delay time.Duration) (conte
 }
 
 // Refresh refreshes the lock by creating a new file in the backend with a new
-// timestamp. Afterwards the old lock is removed.
+// timestamp and, for lease-based locks, a new Expiry. Afterwards the old lock
+// is removed. A lock acquired through a LockBackend is instead refreshed via
+// that backend's Refresh.
 func (l *Lock) Refresh(ctx context.Context) error {
 	debug.Log("refreshing lock %v", l.lockID)
 	l.lock.Lock()
 	l.Time = time.Now()
+	if l.LeaseDuration > 0 {
+		l.Expiry = l.Time.Add(l.LeaseDuration)
+	}
 	l.lock.Unlock()
+
+	if l.backend != nil {
+		handle, err := l.backend.Refresh(ctx, l.backendHandle, l)
+		if err != nil {
+			return err
+		}
+		l.lock.Lock()
+		l.backendHandle = handle
+		l.lock.Unlock()
+		return nil
+	}
+
 	id, err := l.createLock(ctx)
 	if err != nil {
 		return err
@@ -332,6 +574,15 @@ func (l *Lock) Refresh(ctx context.Context) error {
 // RefreshStaleLock is an extended variant of Refresh that can also refresh stale lock files.
 func (l *Lock) RefreshStaleLock(ctx context.Context) error {
 	debug.Log("refreshing stale lock %v", l.lockID)
+
+	if l.backend != nil {
+		// a LockBackend is expected to enforce lease expiry itself, so
+		// refreshing here is no different from a regular Refresh: it either
+		// succeeds because the lease hasn't been reassigned yet, or fails
+		// because someone else has already taken over
+		return l.Refresh(ctx)
+	}
+
 	// refreshing a stale lock is possible if it still exists and continues to do
 	// so until after creating a new lock. The initial check avoids creating a new
 	// lock file if this lock was already removed in the meantime.
@@ -342,8 +593,29 @@ func (l *Lock) RefreshStaleLock(ctx context.Context) error {
 		return ErrRemovedLock
 	}
 
+	if l.LeaseDuration > 0 {
+		// someone else may have already noticed the stale lease and acquired
+		// a new lock with a higher fencing token; refuse to refresh in that
+		// case instead of granting this process false confidence that it
+		// still holds exclusivity. This catches the common case where the
+		// other lock was acquired and listed well before this check, but as
+		// documented on FencingToken it cannot catch a concurrent acquire
+		// that lists at the same time as this check without a LockBackend's
+		// atomic primitive.
+		next, err := nextFencingToken(ctx, l.repo, nil)
+		if err != nil {
+			return err
+		}
+		if next > l.FencingToken+1 {
+			return ErrFencingTokenSuperseded
+		}
+	}
+
 	l.lock.Lock()
 	l.Time = time.Now()
+	if l.LeaseDuration > 0 {
+		l.Expiry = l.Time.Add(l.LeaseDuration)
+	}
 	l.lock.Unlock()
 	id, err := l.createLock(ctx)
 	if err != nil {
@@ -404,6 +676,11 @@ func (l *Lock) String() string {
 		l.Time.Format("2006-01-02 15:04:05"), time.Since(l.Time),
 		l.lockID.Str())
 
+	if l.LeaseDuration > 0 {
+		text += fmt.Sprintf("\nlease expires at %s (fencing token %d)",
+			l.Expiry.Format("2006-01-02 15:04:05"), l.FencingToken)
+	}
+
 	return text
 }
 
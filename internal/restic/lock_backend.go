@@ -0,0 +1,44 @@
+package restic
+
+import "context"
+
+// LockHandle is an opaque reference to a lock acquired through a
+// LockBackend. It is only meaningful to the LockBackend that produced it and
+// must be passed back unmodified to Refresh and Release.
+type LockHandle interface{}
+
+// LockBackend is implemented by backends that can provide an atomic,
+// single-round-trip locking primitive, such as flock(2) on the local
+// backend, a conditional PUT plus object versioning on S3, or a blob lease
+// on Azure. A LockBackend is wired up via LockOptions.Backend (the normal
+// path: the code that constructs repo for a given backend also owns the
+// matching LockBackend and passes it explicitly), or, as a fallback for a
+// repo type that implements both interfaces itself, via a type assertion
+// against the repo passed to NewLock or NewLockWithOptions. Either way, it
+// is used in preference to the generic list-sleep-list protocol built on
+// SaveJSONUnpacked/RemoveUnpacked for LockFile, removing the
+// waitBeforeLockCheck race window and letting an exclusive lock be
+// acquired, or rejected, in a single round trip.
+//
+// LocalLockBackend (lock_backend_local.go) is the only implementation in
+// this tree, covering the local backend. There is no implementation for S3
+// or Azure, so locks on those backends use the generic file-based protocol;
+// their staleness is judged from Expiry only for locks created with
+// LockOptions.Lease, and by the legacy timestamp/process check otherwise.
+type LockBackend interface {
+	// TryAcquire atomically creates a lock with the given contents and
+	// returns a handle identifying it. If a conflicting lock already
+	// exists, it returns an error that satisfies IsAlreadyLocked.
+	TryAcquire(ctx context.Context, lock *Lock) (LockHandle, error)
+	// Refresh atomically replaces the lock identified by handle with the
+	// current contents of lock, extending its lease, and returns a handle
+	// for the result. It fails if the lock has meanwhile been taken over by
+	// someone else.
+	Refresh(ctx context.Context, handle LockHandle, lock *Lock) (LockHandle, error)
+	// Release releases the lock identified by handle.
+	Release(ctx context.Context, handle LockHandle) error
+	// List returns the locks currently visible to the backend, for use in
+	// fencing token computation (nextFencingToken). checkForOtherLocks does
+	// not call it: a lock acquired through a LockBackend skips that check.
+	List(ctx context.Context) ([]*Lock, error)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package restic
+
+import "github.com/restic/restic/internal/errors"
+
+// NewLocalLockBackend is not implemented on Windows: the flock(2)-based
+// LocalLockBackend in lock_backend_local.go relies on POSIX advisory locks.
+// Callers fall back to the generic, poll-based locking protocol when this
+// error is returned.
+func NewLocalLockBackend(dir string) (*LocalLockBackend, error) {
+	return nil, errors.New("lock_backend_local: not implemented on windows")
+}
+
+// LocalLockBackend is an opaque placeholder on Windows; see
+// lock_backend_local.go for the real implementation on other platforms.
+type LocalLockBackend struct{}
@@ -0,0 +1,85 @@
+package restic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsLeaseExpiredNoLease(t *testing.T) {
+	lock := &Lock{Time: time.Now().Add(-time.Hour)}
+	if isLeaseExpired(lock) {
+		t.Error("a lock without a lease must never be reported as lease-expired")
+	}
+}
+
+func TestIsLeaseExpiredBeforeExpiry(t *testing.T) {
+	lock := &Lock{
+		LeaseDuration: time.Minute,
+		Expiry:        time.Now().Add(time.Minute),
+	}
+	if isLeaseExpired(lock) {
+		t.Error("lock with a lease that has not yet expired must not be reported as expired")
+	}
+}
+
+func TestIsLeaseExpiredAfterExpiry(t *testing.T) {
+	lock := &Lock{
+		LeaseDuration: time.Minute,
+		Expiry:        time.Now().Add(-time.Second),
+	}
+	if !isLeaseExpired(lock) {
+		t.Error("lock whose Expiry is in the past must be reported as expired")
+	}
+}
+
+func TestStaleLegacyTimestamp(t *testing.T) {
+	lock := &Lock{Time: time.Now().Add(-2 * StaleLockTimeout)}
+	if !lock.Stale() {
+		t.Error("lock without a lease and with an old timestamp must be stale")
+	}
+}
+
+func TestStaleLeaseUnexpiredIsNotStale(t *testing.T) {
+	// a lease-based lock must not fall through to the legacy
+	// timestamp/process check, even if Time itself looks old
+	lock := &Lock{
+		Time:          time.Now().Add(-2 * StaleLockTimeout),
+		LeaseDuration: time.Hour,
+		Expiry:        time.Now().Add(time.Hour),
+	}
+	if lock.Stale() {
+		t.Error("lock with an unexpired lease must not be stale regardless of Time")
+	}
+}
+
+func TestStaleLeaseExpiredIsStale(t *testing.T) {
+	lock := &Lock{
+		Time:          time.Now(),
+		LeaseDuration: time.Minute,
+		Expiry:        time.Now().Add(-time.Second),
+	}
+	if !lock.Stale() {
+		t.Error("lock with an expired lease must be stale")
+	}
+}
+
+func TestMaxFencingToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		locks []*Lock
+		want  uint64
+	}{
+		{"empty", nil, 0},
+		{"single", []*Lock{{FencingToken: 5}}, 5},
+		{"picks max", []*Lock{{FencingToken: 2}, {FencingToken: 9}, {FencingToken: 4}}, 9},
+		{"ignores nil entries", []*Lock{nil, {FencingToken: 3}, nil}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxFencingToken(tt.locks); got != tt.want {
+				t.Errorf("maxFencingToken() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}